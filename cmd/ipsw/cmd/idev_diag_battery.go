@@ -0,0 +1,100 @@
+/*
+Copyright © 2022 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/utils"
+	"github.com/blacktop/ipsw/pkg/usb/diagnostics"
+	"github.com/blacktop/ipsw/pkg/usb/lockdownd"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	idevDiagCmd.AddCommand(idevDiagBatteryCmd)
+
+	idevDiagBatteryCmd.Flags().Bool("json", false, "Output as JSON")
+}
+
+// idevDiagBatteryCmd represents the battery command
+var idevDiagBatteryCmd = &cobra.Command{
+	Use:           "battery",
+	Short:         "Query the device's GasGauge (battery) diagnostics",
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if Verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		uuid, _ := cmd.Flags().GetString("uuid")
+		asJSON, _ := cmd.Flags().GetBool("json")
+
+		var err error
+		var dev *lockdownd.DeviceValues
+
+		if len(uuid) == 0 {
+			dev, err = utils.PickDevice()
+			if err != nil {
+				return fmt.Errorf("failed to pick USB connected devices: %w", err)
+			}
+		} else {
+			ldc, err := lockdownd.NewClient(uuid)
+			if err != nil {
+				return fmt.Errorf("failed to connect to lockdownd: %w", err)
+			}
+			defer ldc.Close()
+
+			dev, err = ldc.GetValues()
+			if err != nil {
+				return fmt.Errorf("failed to get device values for %s: %w", uuid, err)
+			}
+		}
+
+		cli, err := diagnostics.NewClient(dev.UniqueDeviceID)
+		if err != nil {
+			return fmt.Errorf("failed to connect to diagnostics: %w", err)
+		}
+		defer cli.Close()
+		defer cli.Goodbye()
+
+		gg, err := cli.Diagnostics("GasGauge")
+		if err != nil {
+			return fmt.Errorf("failed to query GasGauge diagnostics: %w", err)
+		}
+
+		if asJSON {
+			return json.NewEncoder(os.Stdout).Encode(gg)
+		}
+
+		for k, v := range gg {
+			fmt.Printf("%s: %v\n", k, v)
+		}
+
+		return nil
+	},
+}
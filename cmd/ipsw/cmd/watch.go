@@ -22,12 +22,22 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/apex/log"
 	"github.com/blacktop/ipsw/internal/download"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -35,22 +45,139 @@ import (
 func init() {
 	rootCmd.AddCommand(watchCmd)
 
-	watchCmd.Flags().StringP("file", "f", "", "Commit file path to watch")
+	watchCmd.Flags().StringSliceP("repo", "r", []string{"WebKit/WebKit"}, "GitHub repo(s) to watch (owner/name)")
+	watchCmd.Flags().StringP("branch", "b", "", "Branch to watch (defaults to the repo's default branch)")
+	watchCmd.Flags().StringP("path", "f", "", "Only watch commits touching this file/folder path")
 	watchCmd.Flags().StringP("pattern", "p", "", "Commit message pattern to match")
-	watchCmd.Flags().IntP("days", "d", 1, "Days back to search for commits")
+	watchCmd.Flags().IntP("days", "d", 1, "Days back to search for commits on the first run")
 	watchCmd.Flags().StringP("api", "a", "", "Github API Token")
+	watchCmd.Flags().String("since", "", "Only show commits at or after this ISO8601 timestamp (overrides the saved cursor; tags and SHAs are not resolved)")
+	watchCmd.Flags().String("webhook", "", "POST each new matching commit as JSON to this URL")
+	watchCmd.Flags().String("webhook-secret", "", "Secret used to HMAC-sign --webhook payloads")
+	watchCmd.Flags().String("exec", "", "Shell command to run for each new matching commit")
 	watchCmd.Flags().Bool("json", false, "Output downloadable tar.gz URLs as JSON")
-	viper.BindPFlag("watch.file", watchCmd.Flags().Lookup("file"))
+	viper.BindPFlag("watch.repo", watchCmd.Flags().Lookup("repo"))
+	viper.BindPFlag("watch.branch", watchCmd.Flags().Lookup("branch"))
+	viper.BindPFlag("watch.path", watchCmd.Flags().Lookup("path"))
 	viper.BindPFlag("watch.pattern", watchCmd.Flags().Lookup("pattern"))
 	viper.BindPFlag("watch.days", watchCmd.Flags().Lookup("days"))
 	viper.BindPFlag("watch.api", watchCmd.Flags().Lookup("api"))
+	viper.BindPFlag("watch.since", watchCmd.Flags().Lookup("since"))
+	viper.BindPFlag("watch.webhook", watchCmd.Flags().Lookup("webhook"))
+	viper.BindPFlag("watch.webhook-secret", watchCmd.Flags().Lookup("webhook-secret"))
+	viper.BindPFlag("watch.exec", watchCmd.Flags().Lookup("exec"))
 	viper.BindPFlag("watch.json", watchCmd.Flags().Lookup("json"))
 }
 
+// watchState is the on-disk cursor persisted between `ipsw watch` runs so
+// that successive invocations only surface commits newer than the last one
+// seen for a given repo/branch/path
+type watchState struct {
+	Cursors map[string]string `json:"cursors"`
+}
+
+// watchStatePath returns ~/.config/ipsw/watch.state.json
+func watchStatePath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "ipsw", "watch.state.json"), nil
+}
+
+func loadWatchState() (*watchState, error) {
+	path, err := watchStatePath()
+	if err != nil {
+		return nil, err
+	}
+	state := &watchState{Cursors: make(map[string]string)}
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(dat, state); err != nil {
+		return nil, err
+	}
+	if state.Cursors == nil {
+		state.Cursors = make(map[string]string)
+	}
+	return state, nil
+}
+
+func (s *watchState) save() error {
+	path, err := watchStatePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+	dat, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, dat, 0o644)
+}
+
+// watchCursorKey identifies a single watched (repo, branch, path) tuple
+func watchCursorKey(repo, branch, path string) string {
+	return fmt.Sprintf("%s@%s:%s", repo, branch, path)
+}
+
+// postWebhook POSTs commit as JSON to hookURL, HMAC-SHA256 signing the body
+// with secret (when set) in an X-Hub-Signature-256 header
+func postWebhook(hookURL, secret string, commit download.Commit) error {
+	payload, err := json.Marshal(commit)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", hookURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if len(secret) > 0 {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(payload)
+		req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to POST webhook %s: %w", hookURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s returned %s", hookURL, resp.Status)
+	}
+	return nil
+}
+
+// execCommit runs execCmd in a shell with commit details exposed as env vars
+func execCommit(execCmd string, repo string, commit download.Commit) error {
+	c := exec.Command("sh", "-c", execCmd)
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	c.Env = append(os.Environ(),
+		"IPSW_COMMIT_REPO="+repo,
+		"IPSW_COMMIT_SHA="+commit.SHA,
+		"IPSW_COMMIT_URL="+commit.URL,
+		"IPSW_COMMIT_AUTHOR="+commit.Author,
+		"IPSW_COMMIT_HEADLINE="+commit.Headline,
+		"IPSW_COMMIT_DATE="+commit.Date.Format(time.RFC3339),
+	)
+	return c.Run()
+}
+
 // watchCmd represents the watch command
 var watchCmd = &cobra.Command{
 	Use:           "watch",
-	Short:         "Watch WebKit Commits",
+	Short:         "Watch GitHub repos for new commits",
 	Args:          cobra.NoArgs,
 	SilenceUsage:  true,
 	SilenceErrors: true,
@@ -61,42 +188,106 @@ var watchCmd = &cobra.Command{
 			log.SetLevel(log.DebugLevel)
 		}
 
-		apiToken := viper.GetString("watch.api")
+		repos := viper.GetStringSlice("watch.repo")
+		branch := viper.GetString("watch.branch")
+		path := viper.GetString("watch.path")
+		pattern := viper.GetString("watch.pattern")
+		days := viper.GetInt("watch.days")
+		since := viper.GetString("watch.since")
+		webhook := viper.GetString("watch.webhook")
+		webhookSecret := viper.GetString("watch.webhook-secret")
+		execCmdline := viper.GetString("watch.exec")
 		asJSON := viper.GetBool("watch.json")
 
+		apiToken := viper.GetString("watch.api")
 		if len(apiToken) == 0 {
 			if val, ok := os.LookupEnv("GITHUB_TOKEN"); ok {
 				apiToken = val
-			} else {
-				if val, ok := os.LookupEnv("GITHUB_API_TOKEN"); ok {
-					apiToken = val
-				}
+			} else if val, ok := os.LookupEnv("GITHUB_API_TOKEN"); ok {
+				apiToken = val
 			}
 		}
 
-		commits, err := download.WebKitCommits(
-			viper.GetString("watch.file"),
-			viper.GetString("watch.pattern"),
-			viper.GetInt("watch.days"),
-			"",
-			false,
-			apiToken)
+		state, err := loadWatchState()
 		if err != nil {
-			return err
+			return fmt.Errorf("failed to load watch state: %w", err)
 		}
 
-		if asJSON {
-			json.NewEncoder(os.Stdout).Encode(commits)
-		} else {
+		var allNew []download.Commit
+
+		for _, repo := range repos {
+			owner, name, ok := strings.Cut(repo, "/")
+			if !ok {
+				return fmt.Errorf("invalid --repo %q (expected owner/name)", repo)
+			}
+
+			key := watchCursorKey(repo, branch, path)
+			cursor := since
+			if len(cursor) == 0 {
+				cursor = state.Cursors[key]
+			}
+			if len(cursor) == 0 {
+				cursor = time.Now().AddDate(0, 0, -days).Format(time.RFC3339)
+			}
+
+			commits, err := download.GetCommits(owner, name, branch, path, pattern, cursor, apiToken)
+			if err != nil {
+				log.Error(errors.Wrapf(err, "failed to watch %s", repo).Error())
+				continue
+			}
+
+			// GetCommits returns newest-first; deliver oldest-first so the
+			// cursor only ever advances past commits that were actually
+			// delivered
+			for i, j := 0, len(commits)-1; i < j; i, j = i+1, j-1 {
+				commits[i], commits[j] = commits[j], commits[i]
+			}
+
 			for _, commit := range commits {
-				fmt.Println(commit.Headline)
-				fmt.Println("---")
-				fmt.Println(commit.Body)
-				println()
-				println()
+				delivered := true
+				if len(webhook) > 0 {
+					if err := postWebhook(webhook, webhookSecret, commit); err != nil {
+						log.Error(err.Error())
+						delivered = false
+					}
+				}
+				if len(execCmdline) > 0 {
+					if err := execCommit(execCmdline, repo, commit); err != nil {
+						log.Error(errors.Wrapf(err, "failed to run --exec for commit %s", commit.SHA).Error())
+						delivered = false
+					}
+				}
+				if !delivered {
+					// stop advancing the cursor here so this commit (and
+					// everything newer) is retried on the next run
+					break
+				}
+				// GitHub's commits API --since filter is inclusive, so advance
+				// past the delivered commit's timestamp or it gets redelivered
+				// on the next run
+				state.Cursors[key] = commit.Date.Add(time.Second).Format(time.RFC3339)
+				allNew = append(allNew, commit)
+			}
+
+			// persist this repo's cursor now, so a later repo's failure can't
+			// cause an early return that loses it
+			if err := state.save(); err != nil {
+				log.Error(errors.Wrap(err, "failed to save watch state").Error())
 			}
 		}
 
+		if asJSON {
+			return json.NewEncoder(os.Stdout).Encode(allNew)
+		}
+
+		for _, commit := range allNew {
+			fmt.Println(commit.Headline)
+			fmt.Println("---")
+			fmt.Println(commit.Body)
+			println()
+			println()
+		}
+
 		return nil
 	},
 }
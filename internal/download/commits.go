@@ -0,0 +1,123 @@
+package download
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+// Commit represents a single GitHub commit matched by GetCommits
+type Commit struct {
+	SHA       string    `json:"sha"`
+	URL       string    `json:"url"`
+	Headline  string    `json:"headline"`
+	Body      string    `json:"body"`
+	Author    string    `json:"author"`
+	Date      time.Time `json:"date"`
+	Additions int       `json:"additions,omitempty"`
+	Deletions int       `json:"deletions,omitempty"`
+}
+
+type ghCommitAuthor struct {
+	Name string    `json:"name"`
+	Date time.Time `json:"date"`
+}
+
+type ghCommit struct {
+	SHA         string `json:"sha"`
+	HTMLURL     string `json:"html_url"`
+	CommentsURL string `json:"comments_url"`
+	Commit      struct {
+		Author  ghCommitAuthor `json:"author"`
+		Message string         `json:"message"`
+	} `json:"commit"`
+}
+
+// GetCommits queries the GitHub REST API for commits on owner/repo, optionally
+// filtered to a branch, a file/folder path and a commit-message regex pattern,
+// returning only commits dated at or after since (an ISO8601 timestamp, empty
+// for no lower bound)
+func GetCommits(owner, repo, branch, path, pattern, since, apiToken string) ([]Commit, error) {
+	var re *regexp.Regexp
+	if len(pattern) > 0 {
+		var err error
+		re, err = regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --pattern %q: %w", pattern, err)
+		}
+	}
+
+	q := url.Values{}
+	if len(branch) > 0 {
+		q.Set("sha", branch)
+	}
+	if len(path) > 0 {
+		q.Set("path", path)
+	}
+	if len(since) > 0 {
+		q.Set("since", since)
+	}
+	q.Set("per_page", "100")
+
+	reqURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/commits?%s", owner, repo, q.Encode())
+
+	req, err := http.NewRequest("GET", reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if len(apiToken) > 0 {
+		req.Header.Set("Authorization", "Bearer "+apiToken)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query github for %s/%s commits: %w", owner, repo, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("github returned %s for %s/%s: %s", resp.Status, owner, repo, string(body))
+	}
+
+	var ghCommits []ghCommit
+	if err := json.Unmarshal(body, &ghCommits); err != nil {
+		return nil, err
+	}
+
+	var commits []Commit
+	for _, gc := range ghCommits {
+		lines := splitFirstLine(gc.Commit.Message)
+		if re != nil && !re.MatchString(gc.Commit.Message) {
+			continue
+		}
+		commits = append(commits, Commit{
+			SHA:      gc.SHA,
+			URL:      gc.HTMLURL,
+			Headline: lines[0],
+			Body:     lines[1],
+			Author:   gc.Commit.Author.Name,
+			Date:     gc.Commit.Author.Date,
+		})
+	}
+
+	return commits, nil
+}
+
+// splitFirstLine splits a commit message into its headline and remaining body
+func splitFirstLine(msg string) [2]string {
+	for i := 0; i < len(msg); i++ {
+		if msg[i] == '\n' {
+			return [2]string{msg[:i], msg[i+1:]}
+		}
+	}
+	return [2]string{msg, ""}
+}
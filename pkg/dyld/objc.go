@@ -35,6 +35,23 @@ func (o Optimization) isPointerAligned() bool {
 	return (binary.Size(o) % 8) == 0
 }
 
+// checkOptVersion rejects objc_opt_t versions we don't know how to decode.
+//
+// dyld shared caches from iOS 13+/macOS Big Sur+ append extra fields to
+// objc_opt_t (a v16 layout). Decoding that layout's SelectorOptOffset table
+// correctly needs version-specific relative-offset entries, which we don't
+// have real v16 cache fixtures to verify against; out of scope for now, so
+// reject it explicitly rather than silently reading a v15-shaped table out
+// of a v16 cache. selectorOffsetsBounds below does handle the orthogonal
+// __objc_scoffs split (selector strings moved out of libobjc) that shows up
+// on the same caches.
+func checkOptVersion(opt Optimization) error {
+	if opt.Version != 15 {
+		return fmt.Errorf("unsupported objc optimization version %d (only 15 is supported)", opt.Version)
+	}
+	return nil
+}
+
 // Precomputed perfect hash table of strings.
 // Base class for precomputed selector table and class table.
 type stringHash struct {
@@ -54,6 +71,9 @@ type StringHash struct {
 	Tab        []byte  /* tab[mask+1] (always power-of-2) */
 	CheckBytes []byte  /* check byte for each string */
 	Offsets    []int32 /* offsets from &capacity to cstrings */
+
+	raw    []byte /* raw bytes of the image/section the table was read out of */
+	rawOff int    /* offset within raw of &capacity (the start of stringHash) */
 }
 
 func (f *File) getLibObjC() (*macho.File, error) {
@@ -87,21 +107,22 @@ func (f *File) GetSelectorAddress(selector string) (uint32, error) {
 
 	for _, s := range m.Sections {
 		if s.Seg == "__TEXT" && s.Name == "__objc_opt_ro" {
-			dat, err := s.Data()
+			secDat, err := s.Data()
 			if err != nil {
 				return 0, err
 			}
-			secReader := bytes.NewReader(dat)
+			secReader := bytes.NewReader(secDat)
 			opt := Optimization{}
 			if err := binary.Read(secReader, f.ByteOrder, &opt); err != nil {
 				return 0, err
 			}
-			if opt.Version != 15 {
-				return 0, fmt.Errorf("objc optimization version should be 15, but found %d", opt.Version)
+			if err := checkOptVersion(opt); err != nil {
+				return 0, err
 			}
 			fmt.Println("Objective-C Optimization:", opt)
-			// TODO: what is this offset from ???
-			r.Seek(int64(int32(s.Offset)+opt.SelectorOptOffset), io.SeekStart)
+			// offset is relative to the start of the Optimization struct (the objc_opt_t)
+			startOff := int64(int32(s.Offset) + opt.SelectorOptOffset)
+			r.Seek(startOff, io.SeekStart)
 
 			shash := StringHash{}
 			if err := binary.Read(r, f.ByteOrder, &shash.stringHash); err != nil {
@@ -119,6 +140,10 @@ func (f *File) GetSelectorAddress(selector string) (uint32, error) {
 			if err := binary.Read(r, f.ByteOrder, &shash.Offsets); err != nil {
 				return 0, err
 			}
+			// offsets in the table are byte offsets from &capacity (the start of
+			// the stringHash struct we just read), not from the section or image
+			shash.raw = dat
+			shash.rawOff = int(startOff)
 
 			ptr, err := shash.getIndex([]byte(selector))
 			if err != nil {
@@ -167,19 +192,362 @@ func (f *File) Selectors(imageNames ...string) error {
 					selectorPtrs[idx] = ptr & mask
 				}
 
-				objcRoSeg := libobjc.Segment("__OBJC_RO")
-				// if objcRoSeg == nil {
-				// 	fmt.Println("  - No selectors.")
-				// 	return fmt.Errorf("segment __OBJC_RO does not exist")
-				// }
-				sr := objcRoSeg.Open()
-				for _, ptr := range selectorPtrs {
-					sr.Seek(int64(ptr-objcRoSeg.Addr), io.SeekStart)
-					s, err := bufio.NewReader(sr).ReadString('\x00')
+				// iOS 15+ caches split the selector strings out of libobjc's
+				// __OBJC_RO segment into their own region (exposed via
+				// __DATA_CONST,__objc_scoffs), so resolve generically by
+				// address instead of assuming __OBJC_RO
+				if methnameBase, methnameEnd, ok := selectorOffsetsBounds(libobjc, f.ByteOrder); ok {
+					for _, ptr := range selectorPtrs {
+						if ptr < methnameBase || ptr >= methnameEnd {
+							log.Error(fmt.Sprintf("selector at 0x%x falls outside the __objc_scoffs methname region [0x%x, 0x%x)", ptr, methnameBase, methnameEnd))
+							continue
+						}
+						str, err := readCStringAt(libobjc, ptr)
+						if err != nil {
+							log.Error(errors.Wrapf(err, "failed to read selector name at: 0x%x", ptr).Error())
+							continue
+						}
+						fmt.Printf("    0x%x: %s\n", ptr, str)
+					}
+				} else {
+					objcRoSeg := libobjc.Segment("__OBJC_RO")
+					sr := objcRoSeg.Open()
+					for _, ptr := range selectorPtrs {
+						sr.Seek(int64(ptr-objcRoSeg.Addr), io.SeekStart)
+						s, err := bufio.NewReader(sr).ReadString('\x00')
+						if err != nil {
+							log.Error(errors.Wrapf(err, "failed to read selector name at: %d", ptr-objcRoSeg.Addr).Error())
+						}
+						fmt.Printf("    0x%x: %s\n", ptr, strings.Trim(s, "\x00"))
+					}
+				}
+			}
+		}
+		m.Close()
+	}
+	return nil
+}
+
+// 64-bit ObjC runtime structures (see objc-runtime-new.h)
+
+type objcClassRoT struct {
+	Flags                uint32
+	InstanceStart        uint32
+	InstanceSize         uint32
+	Reserved             uint32
+	IvarLayoutVMAddr     uint64
+	NameVMAddr           uint64
+	BaseMethodsVMAddr    uint64
+	BaseProtocolsVMAddr  uint64
+	IvarsVMAddr          uint64
+	WeakIvarLayoutVMAddr uint64
+	BasePropertiesVMAddr uint64
+}
+
+type objcProtocolT struct {
+	IsaVMAddr                     uint64
+	NameVMAddr                    uint64
+	ProtocolsVMAddr               uint64
+	InstanceMethodsVMAddr         uint64
+	ClassMethodsVMAddr            uint64
+	OptionalInstanceMethodsVMAddr uint64
+	OptionalClassMethodsVMAddr    uint64
+	InstancePropertiesVMAddr      uint64
+	Size                          uint32
+	Flags                         uint32
+}
+
+type objcCategoryT struct {
+	NameVMAddr               uint64
+	ClsVMAddr                uint64
+	InstanceMethodsVMAddr    uint64
+	ClassMethodsVMAddr       uint64
+	ProtocolsVMAddr          uint64
+	InstancePropertiesVMAddr uint64
+}
+
+// objcScoffs is the __DATA_CONST,__objc_scoffs layout: 4 pointers marking the
+// bounds of the method-name strings and the inline-rw data split off from
+// libobjc's __OBJC_RO segment on iOS 15+ caches
+type objcScoffs struct {
+	MethnameBase uint64
+	MethnameEnd  uint64
+	InlineRwBase uint64
+	InlineRwEnd  uint64
+}
+
+// selectorOffsetsBounds reads m's __DATA_CONST,__objc_scoffs section (if any)
+// and returns the [methnameBase, methnameEnd) VM range selector strings live
+// in on iOS 15+ caches; ok is false when the section isn't present (meaning
+// selector strings still live in libobjc's __OBJC_RO segment)
+func selectorOffsetsBounds(m *macho.File, order binary.ByteOrder) (methnameBase, methnameEnd uint64, ok bool) {
+	for _, s := range m.Sections {
+		if s.Seg == "__DATA_CONST" && s.Name == "__objc_scoffs" {
+			var scoffs objcScoffs
+			if err := binary.Read(s.Open(), order, &scoffs); err != nil {
+				return 0, 0, false
+			}
+			return scoffs.MethnameBase, scoffs.MethnameEnd, true
+		}
+	}
+	return 0, 0, false
+}
+
+// findSection returns the macho.Section whose VM range contains addr
+func findSection(m *macho.File, addr uint64) *macho.Section {
+	for _, sect := range m.Sections {
+		if addr >= sect.Addr && addr < sect.Addr+sect.Size {
+			return sect
+		}
+	}
+	return nil
+}
+
+// readCStringAt reads a NULL-terminated string at a VM address in m
+func readCStringAt(m *macho.File, addr uint64) (string, error) {
+	sect := findSection(m, addr)
+	if sect == nil {
+		return "", fmt.Errorf("address 0x%x not found in any __TEXT/__DATA section", addr)
+	}
+	sr := sect.Open()
+	if _, err := sr.Seek(int64(addr-sect.Addr), io.SeekStart); err != nil {
+		return "", err
+	}
+	str, err := bufio.NewReader(sr).ReadString('\x00')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return strings.Trim(str, "\x00"), nil
+}
+
+// readStructAt reads a fixed-size struct at a VM address in m
+func readStructAt(m *macho.File, addr uint64, order binary.ByteOrder, data interface{}) error {
+	sect := findSection(m, addr)
+	if sect == nil {
+		return fmt.Errorf("address 0x%x not found in any __TEXT/__DATA section", addr)
+	}
+	sr := sect.Open()
+	if _, err := sr.Seek(int64(addr-sect.Addr), io.SeekStart); err != nil {
+		return err
+	}
+	return binary.Read(sr, order, data)
+}
+
+// nameForClass resolves a class_t's class_ro_t and returns its name as stored
+// (no demangling)
+func (f *File) nameForClass(m *macho.File, classPtr uint64) (string, error) {
+	var mask uint64 = 0x7FFFFFFFFFFFF
+	var dataMask uint64 = ^uint64(0x3) // class_rw_t/class_ro_t ptr, low 2 bits are flags
+
+	var roPtr uint64
+	if err := readStructAt(m, classPtr&mask+32, f.ByteOrder, &roPtr); err != nil { // data field
+		return "", err
+	}
+
+	var ro objcClassRoT
+	if err := readStructAt(m, roPtr&dataMask, f.ByteOrder, &ro); err != nil {
+		return "", err
+	}
+
+	return readCStringAt(m, ro.NameVMAddr&mask)
+}
+
+// GetClassAddress returns an Objective-C class's perfect-hash table entry,
+// the same way GetSelectorAddress does for selectors
+func (f *File) GetClassAddress(class string) (uint32, error) {
+	return f.getObjcOptAddress(class, func(opt Optimization) int32 { return opt.ClassOptOffset })
+}
+
+// GetProtocolAddress returns an Objective-C protocol's perfect-hash table
+// entry, the same way GetSelectorAddress does for selectors
+func (f *File) GetProtocolAddress(protocol string) (uint32, error) {
+	return f.getObjcOptAddress(protocol, func(opt Optimization) int32 { return opt.ProtocolOptOffset })
+}
+
+// getObjcOptAddress walks the __objc_opt_ro perfect-hash table selected by
+// offsetFn (selectors/classes/protocols all share the same objc_stringhash_t
+// header) and returns the matching entry's table index. Note this does not
+// walk the class-pointer/duplicate-class arrays that follow a real
+// objc_clsopt_t, so it can't disambiguate two loaded images defining a class
+// of the same name; Classes/Protocols below resolve real names via
+// __objc_classrefs/__objc_protorefs and don't share that limitation.
+func (f *File) getObjcOptAddress(key string, offsetFn func(Optimization) int32) (uint32, error) {
+	image := f.Image("/usr/lib/libobjc.A.dylib")
+
+	dat, err := image.Data()
+	if err != nil {
+		return 0, err
+	}
+	r := bytes.NewReader(dat)
+
+	m, err := macho.NewFile(r)
+	if err != nil {
+		return 0, err
+	}
+	defer m.Close()
+
+	for _, s := range m.Sections {
+		if s.Seg == "__TEXT" && s.Name == "__objc_opt_ro" {
+			secDat, err := s.Data()
+			if err != nil {
+				return 0, err
+			}
+			secReader := bytes.NewReader(secDat)
+			opt := Optimization{}
+			if err := binary.Read(secReader, f.ByteOrder, &opt); err != nil {
+				return 0, err
+			}
+			if err := checkOptVersion(opt); err != nil {
+				return 0, err
+			}
+
+			startOff := int64(int32(s.Offset) + offsetFn(opt))
+			r.Seek(startOff, io.SeekStart)
+
+			shash := StringHash{}
+			if err := binary.Read(r, f.ByteOrder, &shash.stringHash); err != nil {
+				return 0, err
+			}
+			shash.Tab = make([]byte, shash.Mask+1)
+			if err := binary.Read(r, f.ByteOrder, &shash.Tab); err != nil {
+				return 0, err
+			}
+			shash.CheckBytes = make([]byte, shash.Capacity)
+			if err := binary.Read(r, f.ByteOrder, &shash.CheckBytes); err != nil {
+				return 0, err
+			}
+			shash.Offsets = make([]int32, shash.Capacity)
+			if err := binary.Read(r, f.ByteOrder, &shash.Offsets); err != nil {
+				return 0, err
+			}
+			shash.raw = dat
+			shash.rawOff = int(startOff)
+
+			ptr, err := shash.getIndex([]byte(key))
+			if err != nil {
+				return 0, errors.Wrapf(err, "failed get address for %s", key)
+			}
+
+			return ptr, nil
+		}
+	}
+
+	return 0, fmt.Errorf("failed get address for %s", key)
+}
+
+// Classes returns all of the Objective-C classes referenced by imageNames
+// (or every image in the cache if none are given)
+func (f *File) Classes(imageNames ...string) error {
+	return f.dumpObjcRefs("Classes", "__objc_classrefs", imageNames, func(m *macho.File, ptr uint64) (string, error) {
+		return f.nameForClass(m, ptr)
+	})
+}
+
+// Protocols returns all of the Objective-C protocols referenced by imageNames
+// (or every image in the cache if none are given)
+func (f *File) Protocols(imageNames ...string) error {
+	return f.dumpObjcRefs("Protocols", "__objc_protorefs", imageNames, func(m *macho.File, ptr uint64) (string, error) {
+		var mask uint64 = 0x7FFFFFFFFFFFF
+		var proto objcProtocolT
+		if err := readStructAt(m, ptr&mask, f.ByteOrder, &proto); err != nil {
+			return "", err
+		}
+		return readCStringAt(m, proto.NameVMAddr&mask)
+	})
+}
+
+// Categories returns all of the Objective-C categories defined by imageNames
+// (or every image in the cache if none are given). Unlike Classes/Protocols,
+// categories are listed (not referenced) via __objc_catlist, one pointer to a
+// category_t per entry.
+func (f *File) Categories(imageNames ...string) error {
+	var images []*CacheImage
+
+	if len(imageNames) > 0 && len(imageNames[0]) > 0 {
+		for _, imageName := range imageNames {
+			images = append(images, f.Image(imageName))
+		}
+	} else {
+		images = f.Images
+	}
+
+	var mask uint64 = 0x7FFFFFFFFFFFF
+
+	fmt.Println("Objective-C Categories:")
+	for _, image := range images {
+		fmt.Println(image.Name)
+		m, err := image.GetMacho()
+		if err != nil {
+			return errors.Wrapf(err, "failed get image %s as MachO", image.Name)
+		}
+		for _, s := range m.Sections {
+			if s.Seg == "__DATA" && s.Name == "__objc_catlist" {
+				catPtrs := make([]uint64, s.Size/8)
+				if err := binary.Read(s.Open(), f.ByteOrder, &catPtrs); err != nil {
+					return err
+				}
+				for _, ptr := range catPtrs {
+					ptr &= mask
+					var cat objcCategoryT
+					if err := readStructAt(m, ptr, f.ByteOrder, &cat); err != nil {
+						log.Error(errors.Wrapf(err, "failed to read category_t at: 0x%x", ptr).Error())
+						continue
+					}
+					name, err := readCStringAt(m, cat.NameVMAddr&mask)
+					if err != nil {
+						log.Error(errors.Wrapf(err, "failed to read category name at: 0x%x", cat.NameVMAddr&mask).Error())
+						continue
+					}
+					clsName, err := f.nameForClass(m, cat.ClsVMAddr&mask)
+					if err != nil {
+						clsName = fmt.Sprintf("0x%x", cat.ClsVMAddr&mask)
+					}
+					fmt.Printf("    0x%x: %s (%s)\n", ptr, name, clsName)
+				}
+			}
+		}
+		m.Close()
+	}
+	return nil
+}
+
+// dumpObjcRefs prints the names resolved from every pointer in sectName
+// (__objc_classrefs / __objc_protorefs) across imageNames, used by Classes
+// and Protocols
+func (f *File) dumpObjcRefs(title, sectName string, imageNames []string, nameOf func(*macho.File, uint64) (string, error)) error {
+	var images []*CacheImage
+
+	if len(imageNames) > 0 && len(imageNames[0]) > 0 {
+		for _, imageName := range imageNames {
+			images = append(images, f.Image(imageName))
+		}
+	} else {
+		images = f.Images
+	}
+
+	var mask uint64 = 0x7FFFFFFFFFFFF
+
+	fmt.Printf("Objective-C %s:\n", title)
+	for _, image := range images {
+		fmt.Println(image.Name)
+		m, err := image.GetMacho()
+		if err != nil {
+			return errors.Wrapf(err, "failed get image %s as MachO", image.Name)
+		}
+		for _, s := range m.Sections {
+			if s.Seg == "__DATA" && s.Name == sectName {
+				refPtrs := make([]uint64, s.Size/8)
+				if err := binary.Read(s.Open(), f.ByteOrder, &refPtrs); err != nil {
+					return err
+				}
+				for _, ptr := range refPtrs {
+					ptr &= mask
+					name, err := nameOf(m, ptr)
 					if err != nil {
-						log.Error(errors.Wrapf(err, "failed to read selector name at: %d", ptr-objcRoSeg.Addr).Error())
+						log.Error(errors.Wrapf(err, "failed to resolve name at: 0x%x", ptr).Error())
+						continue
 					}
-					fmt.Printf("    0x%x: %s\n", ptr, strings.Trim(s, "\x00"))
+					fmt.Printf("    0x%x: %s\n", ptr, name)
 				}
 			}
 		}
@@ -192,19 +560,25 @@ func (f *File) Selectors(imageNames ...string) error {
 --------------------------------------------------------------------
 mix -- mix 3 64-bit values reversibly.
 mix() takes 48 machine instructions, but only 24 cycles on a superscalar
-  machine (like Intel's new MMX architecture).  It requires 4 64-bit
-  registers for 4::2 parallelism.
+
+	machine (like Intel's new MMX architecture).  It requires 4 64-bit
+	registers for 4::2 parallelism.
+
 All 1-bit deltas, all 2-bit deltas, all deltas composed of top bits of
-  (a,b,c), and all deltas of bottom bits were tested.  All deltas were
-  tested both on random keys and on keys that were nearly all zero.
-  These deltas all cause every bit of c to change between 1/3 and 2/3
-  of the time (well, only 113/400 to 287/400 of the time for some
-  2-bit delta).  These deltas all cause at least 80 bits to change
-  among (a,b,c) when the mix is run either forward or backward (yes it
-  is reversible).
+
+	(a,b,c), and all deltas of bottom bits were tested.  All deltas were
+	tested both on random keys and on keys that were nearly all zero.
+	These deltas all cause every bit of c to change between 1/3 and 2/3
+	of the time (well, only 113/400 to 287/400 of the time for some
+	2-bit delta).  These deltas all cause at least 80 bits to change
+	among (a,b,c) when the mix is run either forward or backward (yes it
+	is reversible).
+
 This implies that a hash using mix64 has no funnels.  There may be
-  characteristics with 3-bit deltas or bigger, I didn't test for
-  those.
+
+	characteristics with 3-bit deltas or bigger, I didn't test for
+	those.
+
 --------------------------------------------------------------------
 */
 func mix64(a, b, c *uint64) {
@@ -356,12 +730,24 @@ func (sh StringHash) getIndex(key []byte) (uint32, error) {
 	if offset == 0 {
 		return 0, fmt.Errorf("INDEX_NOT_FOUND")
 	}
-	// result = (const char *)this + offset
-	// TODO: fix me
-	result := "FIX ME"
+	// result = (const char *)&capacity + offset
+	pos := sh.rawOff + int(offset)
+	if pos < 0 || pos >= len(sh.raw) {
+		return 0, fmt.Errorf("INDEX_NOT_FOUND")
+	}
+	result := cstring(sh.raw[pos:])
 	if result != string(key) {
 		return 0, fmt.Errorf("INDEX_NOT_FOUND")
 	}
 
 	return h, nil
 }
+
+// cstring reads a NULL-terminated string out of b, stopping at the first
+// NULL byte (or the end of b if none is found)
+func cstring(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		return string(b[:i])
+	}
+	return string(b)
+}
@@ -0,0 +1,214 @@
+package dyld
+
+import (
+	"fmt"
+	"math/bits"
+
+	"github.com/pkg/errors"
+)
+
+// maxStringHashSalts bounds how many Jenkins hash salts BuildStringHash will
+// try before giving up on finding a perfect hash for the given keys
+const maxStringHashSalts = 2000
+
+// BuildStringHash synthesizes a new objc_stringhash_t for keys, suitable for
+// patching into a cache or round-tripping against StringHash.getIndex. It
+// implements the classic two-level Jenkins perfect-hash generator: capacity
+// is the next power of two >= 5*n/4, and for each candidate salt every key is
+// grouped by its low-order hash bits (the same bucketing getIndex uses to
+// pick a Tab entry); each bucket is then assigned a Scramble slot such that
+// XOR-ing a key's high-order hash bits with that slot's Scramble value yields
+// a unique, previously unused table slot for every key in the bucket. A
+// bucket that can't be placed (every Scramble slot collides) forces a retry
+// with the next salt.
+func BuildStringHash(keys [][]byte) (*StringHash, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("BuildStringHash: no keys given")
+	}
+	for _, key := range keys {
+		if len(key) == 0 {
+			return nil, fmt.Errorf("BuildStringHash: empty keys are not supported")
+		}
+	}
+
+	capacity := nextPow2(uint32(len(keys)) * 5 / 4)
+	mask := capacity - 1
+	shift := 64 - uint32(bits.TrailingZeros32(capacity))
+
+	for salt := uint64(0); salt < maxStringHashSalts; salt++ {
+		sh, ok := tryBuildStringHash(keys, capacity, mask, shift, salt)
+		if ok {
+			return sh, nil
+		}
+	}
+
+	return nil, errors.Errorf("failed to find a perfect hash for %d keys after %d salts", len(keys), maxStringHashSalts)
+}
+
+// tryBuildStringHash attempts to build a perfect hash table for keys using a
+// single salt, returning ok=false if some bucket can't be placed
+func tryBuildStringHash(keys [][]byte, capacity, mask, shift uint32, salt uint64) (*StringHash, bool) {
+	highBits := make([]uint32, len(keys)) // val >> shift: the part hash() XORs with Scramble
+	buckets := make(map[uint32][]int)     // val & mask -> key indices, mirrors getIndex's Tab lookup
+
+	for i, key := range keys {
+		val := lookup8(key, salt)
+		highBits[i] = uint32(val >> uint64(shift))
+		bucket := uint32(val) & mask
+		buckets[bucket] = append(buckets[bucket], i)
+	}
+
+	// Placing the largest buckets first makes it less likely a late bucket
+	// finds every Scramble slot already spoken for by earlier placements.
+	bucketIDs := make([]uint32, 0, len(buckets))
+	for b := range buckets {
+		bucketIDs = append(bucketIDs, b)
+	}
+	sortByGroupSizeDesc(bucketIDs, buckets)
+
+	scramble := make([]int64, 256) // -1 == unassigned
+	for i := range scramble {
+		scramble[i] = -1
+	}
+	tab := make([]uint8, capacity)
+	used := make([]bool, capacity)
+	slotKey := make([]int, capacity) // slot -> key index, -1 if empty
+	for i := range slotKey {
+		slotKey[i] = -1
+	}
+
+	for _, bucket := range bucketIDs {
+		items := buckets[bucket]
+		if !placeBucket(items, highBits, capacity, scramble, used, slotKey, &tab[bucket]) {
+			return nil, false
+		}
+	}
+
+	return assembleStringHash(keys, capacity, mask, shift, salt, scramble, tab, slotKey), true
+}
+
+// placeBucket finds a Scramble slot (reusing one already assigned by an
+// earlier bucket when possible) such that every key in items lands on a
+// distinct, free table slot. On success it marks those slots used and
+// records the chosen tab index in *tabEntry.
+func placeBucket(items []int, highBits []uint32, capacity uint32, scramble []int64, used []bool, slotKey []int, tabEntry *uint8) bool {
+	for d := 0; d < len(scramble); d++ {
+		if scramble[d] == -1 {
+			if s, ok := placeWithFreshScramble(items, highBits, capacity, used); ok {
+				scramble[d] = int64(s)
+				commitBucket(items, highBits, uint32(s), used, slotKey)
+				*tabEntry = uint8(d)
+				return true
+			}
+			continue
+		}
+		if slotsFor(items, highBits, uint32(scramble[d]), capacity, used) != nil {
+			commitBucket(items, highBits, uint32(scramble[d]), used, slotKey)
+			*tabEntry = uint8(d)
+			return true
+		}
+	}
+	return false
+}
+
+// placeWithFreshScramble searches for a Scramble value (expressed as an XOR
+// basis against the bucket's first key) that places every key in items on a
+// free slot; it is only tried for Scramble indices no other bucket has
+// claimed yet, so the search is free to pick any basis that works
+func placeWithFreshScramble(items []int, highBits []uint32, capacity uint32, used []bool) (uint32, bool) {
+	for slot := uint32(0); slot < capacity; slot++ {
+		if used[slot] {
+			continue
+		}
+		basis := highBits[items[0]] ^ slot
+		if slotsFor(items, highBits, basis, capacity, used) != nil {
+			return basis, true
+		}
+	}
+	return 0, false
+}
+
+// slotsFor returns the table slot each item in items maps to under the given
+// Scramble basis, or nil if any slot is out of range, already used, or
+// shared between two items in this bucket
+func slotsFor(items []int, highBits []uint32, basis uint32, capacity uint32, used []bool) []uint32 {
+	slots := make([]uint32, len(items))
+	seen := make(map[uint32]bool, len(items))
+	for i, idx := range items {
+		slot := highBits[idx] ^ basis
+		if slot >= capacity || used[slot] || seen[slot] {
+			return nil
+		}
+		seen[slot] = true
+		slots[i] = slot
+	}
+	return slots
+}
+
+// commitBucket re-derives and reserves the slots for items under basis
+// (already validated by a prior slotsFor call)
+func commitBucket(items []int, highBits []uint32, basis uint32, used []bool, slotKey []int) {
+	for _, idx := range items {
+		slot := highBits[idx] ^ basis
+		used[slot] = true
+		slotKey[slot] = idx
+	}
+}
+
+// assembleStringHash lays the chosen keys out as consecutive NUL-terminated
+// cstrings and builds the final StringHash around that buffer
+func assembleStringHash(keys [][]byte, capacity, mask, shift uint32, salt uint64, scramble []int64, tab []uint8, slotKey []int) *StringHash {
+	sh := &StringHash{
+		stringHash: stringHash{
+			Capacity: capacity,
+			Occupied: uint32(len(keys)),
+			Shift:    shift,
+			Mask:     mask,
+			Salt:     salt,
+		},
+		Tab:        tab,
+		CheckBytes: make([]byte, capacity),
+		Offsets:    make([]int32, capacity),
+	}
+
+	for i, v := range scramble {
+		if v != -1 {
+			sh.Scramble[i] = uint32(v)
+		}
+	}
+
+	// getIndex treats an offset of 0 as "empty slot", so reserve that byte
+	// with a leading NUL and start real strings at offset 1
+	sh.raw = append(sh.raw, 0)
+
+	for slot, idx := range slotKey {
+		if idx == -1 {
+			continue
+		}
+		sh.Offsets[slot] = int32(len(sh.raw))
+		sh.CheckBytes[slot] = checkbyte(keys[idx])
+		sh.raw = append(sh.raw, keys[idx]...)
+		sh.raw = append(sh.raw, 0)
+	}
+	sh.rawOff = 0
+
+	return sh
+}
+
+// sortByGroupSizeDesc sorts bucketIDs so the largest buckets (hardest to
+// place) are tried first
+func sortByGroupSizeDesc(bucketIDs []uint32, groups map[uint32][]int) {
+	for i := 1; i < len(bucketIDs); i++ {
+		for j := i; j > 0 && len(groups[bucketIDs[j]]) > len(groups[bucketIDs[j-1]]); j-- {
+			bucketIDs[j], bucketIDs[j-1] = bucketIDs[j-1], bucketIDs[j]
+		}
+	}
+}
+
+// nextPow2 returns the smallest power of two >= n (or 1, if n is 0)
+func nextPow2(n uint32) uint32 {
+	if n <= 1 {
+		return 1
+	}
+	return 1 << uint32(bits.Len32(n-1))
+}
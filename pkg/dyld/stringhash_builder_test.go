@@ -0,0 +1,48 @@
+package dyld
+
+import (
+	"fmt"
+	"testing"
+)
+
+// buildKeys returns n distinct, deterministic keys suitable for BuildStringHash
+func buildKeys(n int) [][]byte {
+	keys := make([][]byte, n)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("selector_%d:withArgs:andMore:", i))
+	}
+	return keys
+}
+
+func TestBuildStringHashRoundTrip(t *testing.T) {
+	for _, n := range []int{1, 2, 3, 10, 257, 1000} {
+		n := n
+		t.Run(fmt.Sprintf("%d_keys", n), func(t *testing.T) {
+			keys := buildKeys(n)
+
+			sh, err := BuildStringHash(keys)
+			if err != nil {
+				t.Fatalf("BuildStringHash(%d keys) failed: %v", n, err)
+			}
+
+			for _, key := range keys {
+				if _, err := sh.getIndex(key); err != nil {
+					t.Errorf("getIndex(%q) failed: %v", key, err)
+				}
+			}
+
+			if _, err := sh.getIndex([]byte("not_a_real_selector:")); err == nil {
+				t.Errorf("getIndex matched a key that was never built into the table")
+			}
+		})
+	}
+}
+
+func TestBuildStringHashRejectsEmptyInput(t *testing.T) {
+	if _, err := BuildStringHash(nil); err == nil {
+		t.Errorf("BuildStringHash(nil) should have failed")
+	}
+	if _, err := BuildStringHash([][]byte{[]byte("ok"), {}}); err == nil {
+		t.Errorf("BuildStringHash with an empty key should have failed")
+	}
+}
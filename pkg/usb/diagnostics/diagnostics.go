@@ -0,0 +1,207 @@
+/*
+Copyright © 2022 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+// Package diagnostics talks to the com.apple.mobile.diagnostics_relay service,
+// which exposes device shutdown/restart/sleep as well as MobileGestalt,
+// IORegistry and sub-system diagnostics queries.
+package diagnostics
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/blacktop/ipsw/pkg/usb/lockdownd"
+	"howett.net/plist"
+)
+
+const serviceName = "com.apple.mobile.diagnostics_relay"
+
+// Client represents a connection to the diagnostics_relay service on a device
+type Client struct {
+	c    net.Conn
+	udid string
+}
+
+// NewClient connects to the diagnostics_relay service on the device with the
+// given udid. Some requests (Goodbye/Shutdown/Restart) require an escrow bag
+// from the device's pairing record to authorize on iOS 14+; pass it as the
+// optional escrowBag argument when you have one
+func NewClient(udid string, escrowBag ...[]byte) (*Client, error) {
+	ldc, err := lockdownd.NewClient(udid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to lockdownd: %w", err)
+	}
+	defer ldc.Close()
+
+	var conn net.Conn
+	if len(escrowBag) > 0 {
+		conn, err = ldc.StartServiceWithEscrowBag(serviceName, escrowBag[0])
+	} else {
+		conn, err = ldc.StartService(serviceName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", serviceName, err)
+	}
+
+	return &Client{c: conn, udid: udid}, nil
+}
+
+// Close closes the underlying connection to the diagnostics_relay service
+func (c *Client) Close() error {
+	if c.c == nil {
+		return nil
+	}
+	return c.c.Close()
+}
+
+// request sends req as a binary plist and decodes the service's plist response
+func (c *Client) request(req map[string]any) (map[string]any, error) {
+	data, err := plist.Marshal(req, plist.BinaryFormat)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+	if err := writeFramed(c.c, data); err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	resp, err := readFramed(c.c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	out := make(map[string]any)
+	if _, err := plist.Unmarshal(resp, &out); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if status, ok := out["Status"].(string); ok && status != "Success" {
+		return out, fmt.Errorf("diagnostics_relay request failed: %s", status)
+	}
+
+	return out, nil
+}
+
+// Goodbye tells diagnostics_relay the session is over
+func (c *Client) Goodbye() error {
+	_, err := c.request(map[string]any{"Request": "Goodbye"})
+	return err
+}
+
+// Shutdown powers the device off
+func (c *Client) Shutdown() error {
+	_, err := c.request(map[string]any{"Request": "Shutdown"})
+	return err
+}
+
+// Restart reboots the device
+func (c *Client) Restart() error {
+	_, err := c.request(map[string]any{"Request": "Restart"})
+	return err
+}
+
+// Sleep puts the device to sleep
+func (c *Client) Sleep() error {
+	_, err := c.request(map[string]any{"Request": "Sleep"})
+	return err
+}
+
+// MobileGestalt queries the device's MobileGestalt database for keys,
+// returning the raw "MobileGestalt" response dictionary
+func (c *Client) MobileGestalt(keys []string) (map[string]any, error) {
+	out, err := c.request(map[string]any{
+		"Request":           "MobileGestalt",
+		"MobileGestaltKeys": keys,
+	})
+	if err != nil {
+		return nil, err
+	}
+	diag, _ := out["Diagnostics"].(map[string]any)
+	res, _ := diag["MobileGestalt"].(map[string]any)
+	return res, nil
+}
+
+// IORegistry queries the IOKit registry, optionally scoped to a plane,
+// entry name and/or entry class (pass "" to leave a filter unset)
+func (c *Client) IORegistry(plane, name, class string) (map[string]any, error) {
+	req := map[string]any{"Request": "IORegistry"}
+	if len(plane) > 0 {
+		req["CurrentPlane"] = plane
+	}
+	if len(name) > 0 {
+		req["EntryName"] = name
+	}
+	if len(class) > 0 {
+		req["EntryClass"] = class
+	}
+
+	out, err := c.request(req)
+	if err != nil {
+		return nil, err
+	}
+	res, _ := out["Diagnostics"].(map[string]any)
+	return res, nil
+}
+
+// Diagnostics requests one of the diagnostics_relay sub-diagnostics
+// dictionaries: "WiFi", "GasGauge", "NAND", "HDMI" or "All"
+func (c *Client) Diagnostics(typ string) (map[string]any, error) {
+	if len(typ) == 0 {
+		typ = "All"
+	}
+	out, err := c.request(map[string]any{
+		"Request":     "Diagnostics",
+		"Diagnostics": typ,
+	})
+	if err != nil {
+		return nil, err
+	}
+	res, _ := out["Diagnostics"].(map[string]any)
+	return res, nil
+}
+
+// writeFramed writes a 4-byte big-endian length prefix followed by data, the
+// framing every lockdownd-derived service (including diagnostics_relay) uses
+func writeFramed(w io.Writer, data []byte) error {
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.BigEndian, uint32(len(data))); err != nil {
+		return err
+	}
+	buf.Write(data)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// readFramed reads one length-prefixed plist message
+func readFramed(r io.Reader) ([]byte, error) {
+	var size uint32
+	if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}